@@ -0,0 +1,192 @@
+// Copyright 2016 Mesosphere, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+var (
+	kafkaDiscoveryFlag = StringEnvFlag("kafka-discovery", "framework",
+		"How to discover Kafka brokers when -kafka-brokers is unset: "+
+			"framework, zookeeper, dns-srv, or consul.")
+	kafkaDiscoveryIntervalSFlag = IntEnvFlag("kafka-discovery-interval-s", 60,
+		"Number of seconds between broker discovery refreshes. Zero disables periodic refresh.")
+
+	kafkaZKConnectFlag = StringEnvFlag("kafka-zk-connect", "master.mesos:2181",
+		"Comma separated Zookeeper connect string, used when -kafka-discovery=zookeeper.")
+	kafkaZKChrootFlag = StringEnvFlag("kafka-zk-chroot", "",
+		"Zookeeper chroot under which the Kafka cluster registers itself, e.g. /kafka. "+
+			"Used when -kafka-discovery=zookeeper.")
+
+	kafkaDNSSRVRecordFlag = StringEnvFlag("kafka-dns-srv-record", "",
+		"DNS SRV record to resolve directly to broker host:port pairs, e.g. "+
+			"'_kafka._tcp.kafka.mesos'. Used when -kafka-discovery=dns-srv.")
+
+	kafkaConsulAddrFlag = StringEnvFlag("kafka-consul-addr", "127.0.0.1:8500",
+		"Address of the Consul agent to query, used when -kafka-discovery=consul.")
+	kafkaConsulServiceFlag = StringEnvFlag("kafka-consul-service", "kafka",
+		"Name of the Consul service to look up, used when -kafka-discovery=consul.")
+)
+
+// BrokerDiscovery resolves the current set of Kafka broker endpoints ("host:port").
+// Implementations are called afresh every time the producer (re)connects, and periodically in
+// the background so that membership changes are picked up without a restart.
+type BrokerDiscovery interface {
+	Brokers() ([]string, error)
+}
+
+// newBrokerDiscovery builds the BrokerDiscovery named by -kafka-discovery.
+func newBrokerDiscovery() (BrokerDiscovery, error) {
+	switch *kafkaDiscoveryFlag {
+	case "framework":
+		return FrameworkDiscovery{Framework: *frameworkFlag}, nil
+	case "zookeeper":
+		return ZookeeperDiscovery{Connect: *kafkaZKConnectFlag, Chroot: *kafkaZKChrootFlag}, nil
+	case "dns-srv":
+		return DNSSRVDiscovery{Record: *kafkaDNSSRVRecordFlag}, nil
+	case "consul":
+		return ConsulDiscovery{Addr: *kafkaConsulAddrFlag, Service: *kafkaConsulServiceFlag}, nil
+	default:
+		return nil, fmt.Errorf("Unrecognized -kafka-discovery value %q", *kafkaDiscoveryFlag)
+	}
+}
+
+// FrameworkDiscovery queries the DC/OS Kafka framework's `/v1/connection` REST endpoint, found
+// via a Mesos-DNS SRV lookup. This is the original, and default, discovery mechanism.
+type FrameworkDiscovery struct {
+	Framework string
+}
+
+// Brokers implements BrokerDiscovery.
+func (d FrameworkDiscovery) Brokers() ([]string, error) {
+	return lookupBrokers(d.Framework)
+}
+
+// DNSSRVDiscovery resolves an SRV record directly to broker endpoints, with no intermediate
+// HTTP call. Each SRV target/port pair becomes one "host:port" broker.
+type DNSSRVDiscovery struct {
+	Record string
+}
+
+// Brokers implements BrokerDiscovery.
+func (d DNSSRVDiscovery) Brokers() ([]string, error) {
+	service, proto, name, err := splitSRVRecord(d.Record)
+	if err != nil {
+		return nil, err
+	}
+	_, addrs, err := net.LookupSRV(service, proto, name)
+	if err != nil {
+		return nil, fmt.Errorf("SRV lookup of %s failed: %s", d.Record, err)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("SRV record %s returned no targets", d.Record)
+	}
+	brokers := make([]string, len(addrs))
+	for i, addr := range addrs {
+		brokers[i] = fmt.Sprintf("%s:%d", strings.TrimSuffix(addr.Target, "."), addr.Port)
+	}
+	return brokers, nil
+}
+
+// splitSRVRecord parses a record of the form "_service._proto.name" into the three components
+// expected by net.LookupSRV.
+func splitSRVRecord(record string) (service, proto, name string, err error) {
+	parts := strings.SplitN(record, ".", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "_") || !strings.HasPrefix(parts[1], "_") {
+		return "", "", "", fmt.Errorf(
+			"-kafka-dns-srv-record must look like '_service._proto.name', got %q", record)
+	}
+	return strings.TrimPrefix(parts[0], "_"), strings.TrimPrefix(parts[1], "_"), parts[2], nil
+}
+
+// ZookeeperDiscovery reads the Kafka cluster's broker registrations directly out of Zookeeper,
+// under <chroot>/brokers/ids/*.
+type ZookeeperDiscovery struct {
+	Connect string
+	Chroot  string
+}
+
+type zkBrokerRegistration struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// Brokers implements BrokerDiscovery.
+func (d ZookeeperDiscovery) Brokers() ([]string, error) {
+	conn, _, err := zk.Connect(strings.Split(d.Connect, ","), 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to Zookeeper at %s: %s", d.Connect, err)
+	}
+	defer conn.Close()
+
+	idsPath := d.Chroot + "/brokers/ids"
+	ids, _, err := conn.Children(idsPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list %s: %s", idsPath, err)
+	}
+
+	brokers := make([]string, 0, len(ids))
+	for _, id := range ids {
+		data, _, err := conn.Get(idsPath + "/" + id)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s/%s: %s", idsPath, id, err)
+		}
+		var registration zkBrokerRegistration
+		if err := json.Unmarshal(data, &registration); err != nil {
+			return nil, fmt.Errorf("Failed to parse broker registration %s/%s: %s", idsPath, id, err)
+		}
+		brokers = append(brokers, net.JoinHostPort(registration.Host, strconv.Itoa(registration.Port)))
+	}
+	return brokers, nil
+}
+
+// ConsulDiscovery queries a Consul catalog for the healthy instances of a named service.
+type ConsulDiscovery struct {
+	Addr    string
+	Service string
+}
+
+// Brokers implements BrokerDiscovery.
+func (d ConsulDiscovery) Brokers() ([]string, error) {
+	client, err := api.NewClient(&api.Config{Address: d.Addr})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create Consul client for %s: %s", d.Addr, err)
+	}
+	services, _, err := client.Health().Service(d.Service, "", true, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Consul health lookup of service %s failed: %s", d.Service, err)
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("Consul service %s has no healthy instances", d.Service)
+	}
+	brokers := make([]string, len(services))
+	for i, service := range services {
+		address := service.Service.Address
+		if address == "" {
+			address = service.Node.Address
+		}
+		brokers[i] = net.JoinHostPort(address, strconv.Itoa(service.Service.Port))
+	}
+	return brokers, nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2016 Mesosphere, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import "testing"
+
+func TestSplitSRVRecord(t *testing.T) {
+	service, proto, name, err := splitSRVRecord("_kafka._tcp.kafka.mesos")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if service != "kafka" || proto != "tcp" || name != "kafka.mesos" {
+		t.Fatalf("got (%q, %q, %q), want (\"kafka\", \"tcp\", \"kafka.mesos\")", service, proto, name)
+	}
+}
+
+func TestSplitSRVRecordMalformed(t *testing.T) {
+	for _, record := range []string{
+		"",
+		"kafka.mesos",
+		"_kafka.mesos",
+		"_kafka._tcp",
+		"kafka._tcp.mesos",
+	} {
+		if _, _, _, err := splitSRVRecord(record); err == nil {
+			t.Errorf("splitSRVRecord(%q): expected an error, got none", record)
+		}
+	}
+}
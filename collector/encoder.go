@@ -0,0 +1,299 @@
+// Copyright 2016 Mesosphere, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	kafkaEncodingFlag = StringEnvFlag("kafka-encoding", "json",
+		"Default encoding for outgoing Kafka messages: json, protobuf, or avro.")
+	kafkaTopicEncodingFlag = StringEnvFlag("kafka-topic-encoding", "",
+		"Comma separated list of topic:encoding overrides, e.g. 'metrics:avro,logs:json'.")
+	kafkaSchemaRegistryURLFlag = StringEnvFlag("kafka-schema-registry-url", "",
+		"Confluent Schema Registry URL. Required when any topic uses avro encoding.")
+	kafkaTopicAvroSchemaFlag = StringEnvFlag("kafka-topic-avro-schema", "",
+		"Comma separated list of topic:schema-file-path pairs, providing the Avro schema to "+
+			"auto-register for each avro-encoded topic on first use.")
+)
+
+// MessageEncoder transforms a Message's raw Data into the wire format a topic's consumers
+// expect. runKafkaProducerSession (in kafkaSink.go) applies the topic's encoder before
+// enqueueing to sarama, so the Kafka-specific wire framing lives here rather than in callers.
+type MessageEncoder interface {
+	Encode(data []byte) ([]byte, error)
+}
+
+// JSONEncoder passes data through unchanged. It's the default encoding, matching the
+// pre-existing behavior where KafkaMessage.Data was sent to Kafka exactly as callers built it,
+// whether or not that happened to be JSON.
+type JSONEncoder struct{}
+
+// Encode implements MessageEncoder.
+func (JSONEncoder) Encode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// ProtobufEncoder wraps an already-marshalled protobuf message with a 4-byte big-endian length
+// prefix, the framing Kafka Streams/KSQL protobuf deserializers expect.
+type ProtobufEncoder struct{}
+
+// Encode implements MessageEncoder.
+func (ProtobufEncoder) Encode(data []byte) ([]byte, error) {
+	encoded := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(encoded, uint32(len(data)))
+	copy(encoded[4:], data)
+	return encoded, nil
+}
+
+// avroMagicByte identifies the Confluent wire format: a magic byte, a 4-byte big-endian schema
+// ID, then the Avro binary payload.
+const avroMagicByte = 0x00
+
+// AvroEncoder wraps an already Avro-encoded payload in the Confluent Schema Registry wire
+// format, resolving (and if necessary registering) the subject's schema ID via registry.
+type AvroEncoder struct {
+	registry *schemaRegistryClient
+	subject  string
+	schema   string
+}
+
+// NewAvroEncoder creates an AvroEncoder for the given subject. schema is the Avro schema JSON
+// to auto-register if the subject doesn't already have a matching one in the registry.
+func NewAvroEncoder(registry *schemaRegistryClient, subject, schema string) *AvroEncoder {
+	return &AvroEncoder{registry: registry, subject: subject, schema: schema}
+}
+
+// Encode implements MessageEncoder. data is expected to already be Avro binary encoded
+// according to e.schema.
+func (e *AvroEncoder) Encode(data []byte) ([]byte, error) {
+	id, err := e.registry.schemaID(e.subject, e.schema)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to resolve schema ID for subject %s: %s", e.subject, err)
+	}
+	encoded := make([]byte, 5+len(data))
+	encoded[0] = avroMagicByte
+	binary.BigEndian.PutUint32(encoded[1:5], uint32(id))
+	copy(encoded[5:], data)
+	return encoded, nil
+}
+
+// schemaRegistryClient talks to a Confluent-compatible Schema Registry, caching resolved schema
+// IDs per subject so repeated Encode calls don't round-trip over HTTP.
+type schemaRegistryClient struct {
+	baseURL string
+	client  *http.Client
+
+	mu  sync.Mutex
+	ids map[string]int // subject -> schema ID
+}
+
+func newSchemaRegistryClient(baseURL string) *schemaRegistryClient {
+	return &schemaRegistryClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{},
+		ids:     make(map[string]int),
+	}
+}
+
+// schemaID returns the registry's ID for schema under subject, registering schema as a new
+// version of subject first if looking it up fails.
+func (c *schemaRegistryClient) schemaID(subject, schema string) (int, error) {
+	c.mu.Lock()
+	if id, ok := c.ids[subject]; ok {
+		c.mu.Unlock()
+		return id, nil
+	}
+	c.mu.Unlock()
+
+	id, err := c.lookupSchema(subject, schema)
+	if err != nil {
+		id, err = c.registerSchema(subject, schema)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	c.mu.Lock()
+	c.ids[subject] = id
+	c.mu.Unlock()
+	return id, nil
+}
+
+type schemaRegistryResponse struct {
+	ID int `json:"id"`
+}
+
+func (c *schemaRegistryClient) lookupSchema(subject, schema string) (int, error) {
+	body, err := json.Marshal(map[string]string{"schema": schema})
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Post(
+		fmt.Sprintf("%s/subjects/%s", c.baseURL, subject),
+		"application/vnd.schemaregistry.v1+json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Schema Registry lookup of subject %s returned status %s", subject, resp.Status)
+	}
+	var parsed schemaRegistryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return 0, err
+	}
+	return parsed.ID, nil
+}
+
+func (c *schemaRegistryClient) registerSchema(subject, schema string) (int, error) {
+	body, err := json.Marshal(map[string]string{"schema": schema})
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Post(
+		fmt.Sprintf("%s/subjects/%s/versions", c.baseURL, subject),
+		"application/vnd.schemaregistry.v1+json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Schema Registry registration of subject %s returned status %s", subject, resp.Status)
+	}
+	var parsed schemaRegistryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return 0, err
+	}
+	return parsed.ID, nil
+}
+
+// EncoderRegistry resolves the MessageEncoder to use for a given topic, per -kafka-encoding and
+// -kafka-topic-encoding.
+type EncoderRegistry struct {
+	defaultEncoding  string
+	topicEncodings   map[string]string
+	topicAvroSchemas map[string]string
+	registry         *schemaRegistryClient
+
+	mu       sync.Mutex
+	encoders map[string]MessageEncoder
+}
+
+// NewEncoderRegistry builds an EncoderRegistry from -kafka-encoding, -kafka-topic-encoding, and
+// -kafka-topic-avro-schema.
+func NewEncoderRegistry() (*EncoderRegistry, error) {
+	topicEncodings, err := parseTopicPairs(*kafkaTopicEncodingFlag, "-kafka-topic-encoding")
+	if err != nil {
+		return nil, err
+	}
+	topicAvroSchemaPaths, err := parseTopicPairs(*kafkaTopicAvroSchemaFlag, "-kafka-topic-avro-schema")
+	if err != nil {
+		return nil, err
+	}
+
+	topicAvroSchemas := map[string]string{}
+	for topic, path := range topicAvroSchemaPaths {
+		schema, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read Avro schema %s for topic %s: %s", path, topic, err)
+		}
+		topicAvroSchemas[topic] = string(schema)
+	}
+
+	var registry *schemaRegistryClient
+	if len(*kafkaSchemaRegistryURLFlag) != 0 {
+		registry = newSchemaRegistryClient(*kafkaSchemaRegistryURLFlag)
+	}
+
+	return &EncoderRegistry{
+		defaultEncoding:  *kafkaEncodingFlag,
+		topicEncodings:   topicEncodings,
+		topicAvroSchemas: topicAvroSchemas,
+		registry:         registry,
+		encoders:         make(map[string]MessageEncoder),
+	}, nil
+}
+
+// parseTopicPairs parses a comma separated "topic:value" list, as used by both
+// -kafka-topic-encoding and -kafka-topic-avro-schema.
+func parseTopicPairs(flagValue, flagName string) (map[string]string, error) {
+	pairs := map[string]string{}
+	if len(flagValue) == 0 {
+		return pairs, nil
+	}
+	for _, pair := range strings.Split(flagValue, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return nil, fmt.Errorf("%s entries must look like 'topic:value', got %q", flagName, pair)
+		}
+		pairs[parts[0]] = parts[1]
+	}
+	return pairs, nil
+}
+
+// Encode applies topic's configured encoding to data.
+func (r *EncoderRegistry) Encode(topic string, data []byte) ([]byte, error) {
+	encoder, err := r.encoderFor(topic)
+	if err != nil {
+		return nil, err
+	}
+	return encoder.Encode(data)
+}
+
+func (r *EncoderRegistry) encoderFor(topic string) (MessageEncoder, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if encoder, ok := r.encoders[topic]; ok {
+		return encoder, nil
+	}
+
+	encoding := r.defaultEncoding
+	if override, ok := r.topicEncodings[topic]; ok {
+		encoding = override
+	}
+
+	var encoder MessageEncoder
+	switch encoding {
+	case "json":
+		encoder = JSONEncoder{}
+	case "protobuf":
+		encoder = ProtobufEncoder{}
+	case "avro":
+		if r.registry == nil {
+			return nil, fmt.Errorf("-kafka-schema-registry-url must be set to use avro encoding (topic %s)", topic)
+		}
+		schema, ok := r.topicAvroSchemas[topic]
+		if !ok {
+			return nil, fmt.Errorf("-kafka-topic-avro-schema must provide a schema for avro topic %s", topic)
+		}
+		// Confluent's convention: the subject for a topic's value schema is "<topic>-value".
+		encoder = NewAvroEncoder(r.registry, topic+"-value", schema)
+	default:
+		return nil, fmt.Errorf("Unrecognized encoding %q for topic %s", encoding, topic)
+	}
+
+	r.encoders[topic] = encoder
+	return encoder, nil
+}
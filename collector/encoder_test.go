@@ -0,0 +1,107 @@
+// Copyright 2016 Mesosphere, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import "testing"
+
+func TestParseTopicPairs(t *testing.T) {
+	pairs, err := parseTopicPairs("metrics:avro,logs:json", "-kafka-topic-encoding")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string]string{"metrics": "avro", "logs": "json"}
+	if len(pairs) != len(want) {
+		t.Fatalf("got %v, want %v", pairs, want)
+	}
+	for topic, value := range want {
+		if pairs[topic] != value {
+			t.Errorf("pairs[%q] = %q, want %q", topic, pairs[topic], value)
+		}
+	}
+}
+
+func TestParseTopicPairsEmpty(t *testing.T) {
+	pairs, err := parseTopicPairs("", "-kafka-topic-encoding")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pairs) != 0 {
+		t.Fatalf("got %v, want empty map", pairs)
+	}
+}
+
+func TestParseTopicPairsMalformed(t *testing.T) {
+	for _, value := range []string{"metrics", "metrics:", ":avro", "metrics:avro,logs"} {
+		if _, err := parseTopicPairs(value, "-kafka-topic-encoding"); err == nil {
+			t.Errorf("parseTopicPairs(%q): expected an error, got none", value)
+		}
+	}
+}
+
+func TestEncoderRegistryEncoderFor(t *testing.T) {
+	registry := &EncoderRegistry{
+		defaultEncoding: "json",
+		topicEncodings:  map[string]string{"binary": "protobuf"},
+		encoders:        make(map[string]MessageEncoder),
+	}
+
+	jsonEncoder, err := registry.encoderFor("metrics")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := jsonEncoder.(JSONEncoder); !ok {
+		t.Errorf("encoderFor(\"metrics\") = %T, want JSONEncoder", jsonEncoder)
+	}
+
+	protoEncoder, err := registry.encoderFor("binary")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := protoEncoder.(ProtobufEncoder); !ok {
+		t.Errorf("encoderFor(\"binary\") = %T, want ProtobufEncoder", protoEncoder)
+	}
+}
+
+func TestEncoderRegistryEncoderForUnknownEncoding(t *testing.T) {
+	registry := &EncoderRegistry{
+		defaultEncoding: "xml",
+		encoders:        make(map[string]MessageEncoder),
+	}
+	if _, err := registry.encoderFor("metrics"); err == nil {
+		t.Fatal("expected an error for an unrecognized encoding, got none")
+	}
+}
+
+func TestEncoderRegistryEncoderForAvroWithoutRegistry(t *testing.T) {
+	registry := &EncoderRegistry{
+		defaultEncoding:  "avro",
+		topicAvroSchemas: map[string]string{"metrics": `{"type": "string"}`},
+		encoders:         make(map[string]MessageEncoder),
+	}
+	if _, err := registry.encoderFor("metrics"); err == nil {
+		t.Fatal("expected an error when -kafka-schema-registry-url is unset, got none")
+	}
+}
+
+func TestEncoderRegistryEncoderForAvroWithoutSchema(t *testing.T) {
+	registry := &EncoderRegistry{
+		defaultEncoding: "avro",
+		registry:        newSchemaRegistryClient("http://registry.example:8081"),
+		encoders:        make(map[string]MessageEncoder),
+	}
+	if _, err := registry.encoderFor("metrics"); err == nil {
+		t.Fatal("expected an error when no schema is configured for the topic, got none")
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 Mesosphere, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	fileOutputPathFlag = StringEnvFlag("file-output-path", "metrics.json",
+		"Path to write newline-delimited JSON metrics to, when -output includes 'file'.")
+	fileMaxBytesFlag = IntEnvFlag("file-max-bytes", 100*1024*1024,
+		"Rotate the file output once it reaches this many bytes. Zero disables size-based rotation.")
+	fileMaxAgeFlag = IntEnvFlag("file-max-age-s", 3600,
+		"Rotate the file output once it's been open this many seconds. Zero disables time-based rotation.")
+)
+
+// FileSink appends Messages as newline-delimited JSON to a file, rotating it by size or age.
+// Rotated files are renamed with a ".<unix timestamp>" suffix.
+type FileSink struct {
+	stats chan<- StatsEvent
+
+	mu       sync.Mutex
+	file     *os.File
+	openedAt time.Time
+	written  int64
+}
+
+// NewFileSink creates a FileSink. Call Start before Send.
+func NewFileSink(stats chan<- StatsEvent) *FileSink {
+	return &FileSink{stats: stats}
+}
+
+// Start implements MessageSink.
+func (s *FileSink) Start(ctx context.Context) error {
+	return s.openLocked()
+}
+
+// Send implements MessageSink.
+func (s *FileSink) Send(message Message) error {
+	line, err := encodeMessageJSON(message)
+	if err != nil {
+		return fmt.Errorf("Failed to encode message for topic %s: %s", message.Topic, err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.needsRotationLocked() {
+		if err := s.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.written += int64(n)
+	if err != nil {
+		return fmt.Errorf("Failed to write message for topic %s to %s: %s", message.Topic, *fileOutputPathFlag, err)
+	}
+	s.stats <- MakeEventSuff(MessageSent, message.Topic)
+	return nil
+}
+
+// Close implements MessageSink.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *FileSink) needsRotationLocked() bool {
+	if *fileMaxBytesFlag > 0 && s.written >= int64(*fileMaxBytesFlag) {
+		return true
+	}
+	if *fileMaxAgeFlag > 0 && time.Since(s.openedAt) >= time.Duration(*fileMaxAgeFlag)*time.Second {
+		return true
+	}
+	return false
+}
+
+func (s *FileSink) rotateLocked() error {
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			log.Println("Failed to close rotated file output cleanly:", err)
+		}
+		rotatedPath := fmt.Sprintf("%s.%d", *fileOutputPathFlag, time.Now().Unix())
+		if err := os.Rename(*fileOutputPathFlag, rotatedPath); err != nil {
+			log.Println("Failed to rename rotated file output:", err)
+		}
+	}
+	return s.openLocked()
+}
+
+func (s *FileSink) openLocked() error {
+	file, err := os.OpenFile(*fileOutputPathFlag, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to open file output %s: %s", *fileOutputPathFlag, err)
+	}
+	s.file = file
+	s.openedAt = time.Now()
+	s.written = 0
+	if info, err := file.Stat(); err == nil {
+		s.written = info.Size()
+	}
+	return nil
+}
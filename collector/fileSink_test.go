@@ -0,0 +1,102 @@
+// Copyright 2016 Mesosphere, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSinkNeedsRotationLocked(t *testing.T) {
+	originalMaxBytes := *fileMaxBytesFlag
+	originalMaxAge := *fileMaxAgeFlag
+	defer func() {
+		*fileMaxBytesFlag = originalMaxBytes
+		*fileMaxAgeFlag = originalMaxAge
+	}()
+
+	*fileMaxBytesFlag = 100
+	*fileMaxAgeFlag = 3600
+
+	s := &FileSink{written: 50, openedAt: time.Now()}
+	if s.needsRotationLocked() {
+		t.Error("needsRotationLocked true below both thresholds")
+	}
+
+	s.written = 150
+	if !s.needsRotationLocked() {
+		t.Error("needsRotationLocked false once -file-max-bytes is exceeded")
+	}
+
+	s.written = 0
+	s.openedAt = time.Now().Add(-2 * time.Hour)
+	if !s.needsRotationLocked() {
+		t.Error("needsRotationLocked false once -file-max-age-s is exceeded")
+	}
+
+	*fileMaxBytesFlag = 0
+	*fileMaxAgeFlag = 0
+	s.written = 1 << 30
+	s.openedAt = time.Now().Add(-100 * time.Hour)
+	if s.needsRotationLocked() {
+		t.Error("needsRotationLocked true with both thresholds set to 0 (disabled)")
+	}
+}
+
+func TestFileSinkRotatesOnSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileSinkTest")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	originalPath := *fileOutputPathFlag
+	originalMaxBytes := *fileMaxBytesFlag
+	originalMaxAge := *fileMaxAgeFlag
+	defer func() {
+		*fileOutputPathFlag = originalPath
+		*fileMaxBytesFlag = originalMaxBytes
+		*fileMaxAgeFlag = originalMaxAge
+	}()
+
+	*fileOutputPathFlag = filepath.Join(dir, "metrics.json")
+	*fileMaxBytesFlag = 10
+	*fileMaxAgeFlag = 0
+
+	stats := make(chan StatsEvent, 10)
+	s := NewFileSink(stats)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %s", err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := s.Send(Message{Topic: "metrics", Data: []byte(`{"a":1}`)}); err != nil {
+			t.Fatalf("Send failed: %s", err)
+		}
+	}
+
+	matches, err := filepath.Glob(*fileOutputPathFlag + ".*")
+	if err != nil {
+		t.Fatalf("Glob failed: %s", err)
+	}
+	if len(matches) == 0 {
+		t.Error("expected at least one rotated file once -file-max-bytes was exceeded, found none")
+	}
+}
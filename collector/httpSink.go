@@ -0,0 +1,174 @@
+// Copyright 2016 Mesosphere, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+var (
+	httpURLFlag = StringEnvFlag("http-output-url", "",
+		"URL to POST batched JSON metrics to, when -output includes 'http'.")
+	httpBatchSizeFlag = IntEnvFlag("http-batch-size", 100,
+		"Number of messages to accumulate before POSTing a batch.")
+	httpBatchPeriodMsFlag = IntEnvFlag("http-batch-period-ms", 5000,
+		"Maximum number of milliseconds to wait for a batch to fill before POSTing it anyway.")
+	httpRetryMaxFlag = IntEnvFlag("http-retry-max", 3,
+		"Number of times to retry a failed POST before dropping the batch.")
+	httpRetryBackoffMsFlag = IntEnvFlag("http-retry-backoff-ms", 250,
+		"Number of milliseconds to wait before retrying a failed POST.")
+)
+
+// HTTPSink POSTs batches of Messages, JSON encoded, to a configured URL.
+type HTTPSink struct {
+	stats  chan<- StatsEvent
+	client *http.Client
+
+	messages chan Message
+	cancel   context.CancelFunc
+}
+
+// NewHTTPSink creates an HTTPSink. Call Start to begin delivering batches.
+func NewHTTPSink(stats chan<- StatsEvent) *HTTPSink {
+	return &HTTPSink{
+		stats:    stats,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		messages: make(chan Message, *httpBatchSizeFlag),
+	}
+}
+
+// Start implements MessageSink.
+func (s *HTTPSink) Start(ctx context.Context) error {
+	if len(*httpURLFlag) == 0 {
+		return fmt.Errorf("-http-output-url must be set when -output includes 'http'")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	go s.run(ctx)
+	return nil
+}
+
+// Send implements MessageSink.
+func (s *HTTPSink) Send(message Message) error {
+	select {
+	case s.messages <- message:
+		return nil
+	default:
+		s.stats <- MakeEventSuff(MessageDropped, message.Topic)
+		return fmt.Errorf("HTTP sink queue full, dropped message for topic %s", message.Topic)
+	}
+}
+
+// Close implements MessageSink.
+func (s *HTTPSink) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return nil
+}
+
+func (s *HTTPSink) run(ctx context.Context) {
+	batchPeriod := time.Duration(*httpBatchPeriodMsFlag) * time.Millisecond
+	ticker := time.NewTicker(batchPeriod)
+	defer ticker.Stop()
+
+	var batch []Message
+	flush := func(postCtx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.postWithRetry(postCtx, batch); err != nil {
+			log.Println("Failed to POST metrics batch:", err)
+			for _, message := range batch {
+				s.stats <- MakeEventSuff(MessageDropped, message.Topic)
+			}
+		} else {
+			for _, message := range batch {
+				s.stats <- MakeEventSuff(MessageSent, message.Topic)
+			}
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case message := <-s.messages:
+			batch = append(batch, message)
+			if len(batch) >= *httpBatchSizeFlag {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+			// ctx is already cancelled, so give the final flush its own bounded
+			// context instead of one that would fail every request immediately.
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), s.client.Timeout)
+			flush(shutdownCtx)
+			cancel()
+			return
+		}
+	}
+}
+
+func (s *HTTPSink) postWithRetry(ctx context.Context, batch []Message) error {
+	lines := make([]json.RawMessage, len(batch))
+	for i, message := range batch {
+		line, err := encodeMessageJSON(message)
+		if err != nil {
+			return fmt.Errorf("Failed to encode message for topic %s: %s", message.Topic, err)
+		}
+		lines[i] = line
+	}
+	body, err := json.Marshal(lines)
+	if err != nil {
+		return fmt.Errorf("Failed to encode batch of %d messages: %s", len(batch), err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= *httpRetryMaxFlag; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(*httpRetryBackoffMsFlag) * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, *httpURLFlag, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("Failed to build request for %s: %s", *httpURLFlag, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := s.client.Do(req)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("Unexpected status %s from %s", resp.Status, *httpURLFlag)
+	}
+	return lastErr
+}
@@ -0,0 +1,203 @@
+// Copyright 2016 Mesosphere, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func withHTTPSinkFlags(t *testing.T, batchSize, batchPeriodMs, retryMax, retryBackoffMs int, url string) {
+	t.Helper()
+
+	originalURL := *httpURLFlag
+	originalBatchSize := *httpBatchSizeFlag
+	originalBatchPeriodMs := *httpBatchPeriodMsFlag
+	originalRetryMax := *httpRetryMaxFlag
+	originalRetryBackoffMs := *httpRetryBackoffMsFlag
+	t.Cleanup(func() {
+		*httpURLFlag = originalURL
+		*httpBatchSizeFlag = originalBatchSize
+		*httpBatchPeriodMsFlag = originalBatchPeriodMs
+		*httpRetryMaxFlag = originalRetryMax
+		*httpRetryBackoffMsFlag = originalRetryBackoffMs
+	})
+
+	*httpURLFlag = url
+	*httpBatchSizeFlag = batchSize
+	*httpBatchPeriodMsFlag = batchPeriodMs
+	*httpRetryMaxFlag = retryMax
+	*httpRetryBackoffMsFlag = retryBackoffMs
+}
+
+func TestHTTPSinkFlushesOnBatchSize(t *testing.T) {
+	requests := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	withHTTPSinkFlags(t, 2, 60000, 0, 1, server.URL)
+
+	stats := make(chan StatsEvent, 10)
+	s := NewHTTPSink(stats)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %s", err)
+	}
+	defer s.Close()
+
+	s.Send(Message{Topic: "metrics", Data: []byte(`{"a":1}`)})
+	s.Send(Message{Topic: "metrics", Data: []byte(`{"a":2}`)})
+
+	select {
+	case body := <-requests:
+		var lines []json.RawMessage
+		if err := json.Unmarshal(body, &lines); err != nil {
+			t.Fatalf("Failed to decode posted batch: %s", err)
+		}
+		if len(lines) != 2 {
+			t.Errorf("posted batch has %d messages, want 2 (flush should trigger once -http-batch-size is reached)", len(lines))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for batch-size-triggered flush")
+	}
+}
+
+func TestHTTPSinkFlushesOnPeriod(t *testing.T) {
+	requests := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	withHTTPSinkFlags(t, 100, 50, 0, 1, server.URL)
+
+	stats := make(chan StatsEvent, 10)
+	s := NewHTTPSink(stats)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %s", err)
+	}
+	defer s.Close()
+
+	s.Send(Message{Topic: "metrics", Data: []byte(`{"a":1}`)})
+
+	select {
+	case body := <-requests:
+		var lines []json.RawMessage
+		if err := json.Unmarshal(body, &lines); err != nil {
+			t.Fatalf("Failed to decode posted batch: %s", err)
+		}
+		if len(lines) != 1 {
+			t.Errorf("posted batch has %d messages, want 1 (flush should trigger on the -http-batch-period-ms ticker)", len(lines))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for period-triggered flush")
+	}
+}
+
+func TestHTTPSinkRetriesOnFailure(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	withHTTPSinkFlags(t, 1, 60000, 3, 1, server.URL)
+
+	stats := make(chan StatsEvent, 10)
+	s := NewHTTPSink(stats)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %s", err)
+	}
+	defer s.Close()
+
+	s.Send(Message{Topic: "metrics", Data: []byte(`{"a":1}`)})
+
+	deadline := time.After(2 * time.Second)
+	for {
+		if atomic.LoadInt32(&attempts) >= 3 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("got %d attempts in 2s, want at least 3 (2 failures + 1 success within -http-retry-max)", atomic.LoadInt32(&attempts))
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	select {
+	case <-stats:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for stats event after retried POST succeeded")
+	}
+}
+
+func TestHTTPSinkFlushesOnShutdown(t *testing.T) {
+	requests := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	withHTTPSinkFlags(t, 100, 60000, 0, 1, server.URL)
+
+	stats := make(chan StatsEvent, 10)
+	s := NewHTTPSink(stats)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %s", err)
+	}
+
+	s.Send(Message{Topic: "metrics", Data: []byte(`{"a":1}`)})
+
+	// Give Send's batch a moment to land before triggering the shutdown flush.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case body := <-requests:
+		var lines []json.RawMessage
+		if err := json.Unmarshal(body, &lines); err != nil {
+			t.Fatalf("Failed to decode posted batch: %s", err)
+		}
+		if len(lines) != 1 {
+			t.Errorf("posted batch has %d messages, want 1 (shutdown should flush the pending batch)", len(lines))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for shutdown-triggered flush; it should not be short-circuited by the cancelled context")
+	}
+}
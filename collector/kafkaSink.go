@@ -0,0 +1,456 @@
+// Copyright 2016 Mesosphere, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+var (
+	brokersFlag = StringEnvFlag("kafka-brokers", "",
+		"The Kafka brokers to connect to, as a comma separated list. (overrides -kafka-framework)")
+	frameworkFlag = StringEnvFlag("kafka-framework", "kafka",
+		"The Kafka framework to query for brokers.")
+	flushPeriodFlag = IntEnvFlag("kafka-flush-ms", 5000,
+		"Number of milliseconds to wait between output flushes")
+	snappyCompressionFlag = BoolEnvFlag("kafka-compress-snappy", true,
+		"Enables Snappy compression on outgoing Kafka data")
+	requireAllAcksFlag = BoolEnvFlag("kafka-require-all-acks", false,
+		"Requires that outgoing data be committed by all Kafka replicas (true) "+
+			"rather than committed by just one replica (false)")
+	kafkaVerboseFlag = BoolEnvFlag("kafka-verbose", false,
+		"Enable extra logging in the underlying Kafka client.")
+
+	kafkaTLSCertFlag = StringEnvFlag("kafka-tls-cert", "",
+		"Path to a PEM encoded client certificate to present to the Kafka brokers over TLS.")
+	kafkaTLSKeyFlag = StringEnvFlag("kafka-tls-key", "",
+		"Path to the PEM encoded private key matching -kafka-tls-cert.")
+	kafkaTLSCAFlag = StringEnvFlag("kafka-tls-ca", "",
+		"Path to a PEM encoded CA bundle used to verify the Kafka brokers' certificates. "+
+			"(falls back to the system CA pool if unset)")
+	kafkaTLSVerifyFlag = BoolEnvFlag("kafka-tls-verify", true,
+		"Verify the Kafka brokers' TLS certificates. Disable only for testing against self-signed brokers.")
+
+	kafkaSASLUserFlag = StringEnvFlag("kafka-sasl-user", "",
+		"SASL username to authenticate against the Kafka brokers with. (enables SASL when set)")
+	kafkaSASLPasswordFlag = StringEnvFlag("kafka-sasl-password", "",
+		"SASL password matching -kafka-sasl-user.")
+	kafkaSASLMechanismFlag = StringEnvFlag("kafka-sasl-mechanism", "PLAIN",
+		"SASL mechanism to use: PLAIN, SCRAM-SHA-256, or SCRAM-SHA-512.")
+
+	kafkaPartitionerFlag = StringEnvFlag("kafka-partitioner", "",
+		"Partitioning strategy to use: hash, roundrobin, random, or manual. "+
+			"Defaults to hash when a message Key is set, random otherwise.")
+
+	kafkaRetryMaxFlag = IntEnvFlag("kafka-retry-max", 3,
+		"Number of times to retry sending a message before giving up on it.")
+	kafkaRetryBackoffMsFlag = IntEnvFlag("kafka-retry-backoff-ms", 250,
+		"Number of milliseconds to wait before retrying a failed send.")
+	kafkaMaxInFlightFlag = IntEnvFlag("kafka-max-in-flight", 256,
+		"Maximum number of messages that may be queued for sending to Kafka at once. "+
+			"Once full, new messages are dropped (and counted) rather than blocking the caller.")
+)
+
+// KafkaSink is a MessageSink that publishes Messages to a Kafka cluster via sarama's async
+// producer, reconnecting for as long as the sink is running.
+type KafkaSink struct {
+	stats     chan<- StatsEvent
+	messages  chan Message
+	reconnect chan struct{}
+	encoders  *EncoderRegistry
+	cancel    context.CancelFunc
+}
+
+// NewKafkaSink creates a KafkaSink. Call Start to begin delivering messages.
+func NewKafkaSink(stats chan<- StatsEvent) *KafkaSink {
+	return &KafkaSink{
+		stats:     stats,
+		messages:  make(chan Message, *kafkaMaxInFlightFlag),
+		reconnect: make(chan struct{}, 1),
+	}
+}
+
+// Start implements MessageSink.
+func (s *KafkaSink) Start(ctx context.Context) error {
+	if *kafkaVerboseFlag {
+		sarama.Logger = log.New(os.Stdout, "[sarama] ", log.LstdFlags)
+	}
+	encoders, err := NewEncoderRegistry()
+	if err != nil {
+		return fmt.Errorf("Failed to configure Kafka message encoders: %s", err)
+	}
+	s.encoders = encoders
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	go func() {
+		for ctx.Err() == nil {
+			runKafkaProducerSession(ctx, s.messages, s.stats, s.reconnect, s.encoders)
+		}
+	}()
+	if len(*brokersFlag) == 0 {
+		go s.watchBrokers(ctx)
+	}
+	return nil
+}
+
+// watchBrokers periodically re-runs broker discovery and requests a reconnect whenever the
+// broker set changes, so membership changes are picked up without restarting the collector.
+func (s *KafkaSink) watchBrokers(ctx context.Context) {
+	if *kafkaDiscoveryIntervalSFlag <= 0 {
+		return
+	}
+	discovery, err := newBrokerDiscovery()
+	if err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(*kafkaDiscoveryIntervalSFlag) * time.Second)
+	defer ticker.Stop()
+
+	var lastBrokers []string
+	for {
+		select {
+		case <-ticker.C:
+			brokers, err := discovery.Brokers()
+			if err != nil {
+				log.Println("Periodic broker discovery failed:", err)
+				continue
+			}
+			sort.Strings(brokers)
+			if lastBrokers != nil && !reflect.DeepEqual(brokers, lastBrokers) {
+				log.Println("Kafka broker set changed, reconnecting:", strings.Join(brokers, ", "))
+				select {
+				case s.reconnect <- struct{}{}:
+				default:
+				}
+			}
+			lastBrokers = brokers
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Send implements MessageSink. It drops (and counts) the message rather than blocking when the
+// sink's internal queue is full.
+func (s *KafkaSink) Send(message Message) error {
+	select {
+	case s.messages <- message:
+		return nil
+	default:
+		s.stats <- MakeEventSuff(KafkaMessageDropped, message.Topic)
+		return fmt.Errorf("Kafka sink queue full, dropped message for topic %s", message.Topic)
+	}
+}
+
+// Close implements MessageSink.
+func (s *KafkaSink) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return nil
+}
+
+// runKafkaProducerSession owns a single Kafka producer connection end to end, making sure the
+// producer is always closed before this function returns (and the caller reconnects).
+func runKafkaProducerSession(ctx context.Context, messages <-chan Message, stats chan<- StatsEvent, reconnect <-chan struct{}, encoders *EncoderRegistry) {
+	producer, err := kafkaProducer(stats)
+	if err != nil {
+		stats <- MakeEvent(KafkaConnectionFailed)
+		log.Println("Failed to open Kafka producer:", err)
+		// reuse flush period as the retry delay:
+		log.Printf("Waiting for %dms\n", *flushPeriodFlag)
+		time.Sleep(time.Duration(*flushPeriodFlag) * time.Millisecond)
+		return
+	}
+	stats <- MakeEvent(KafkaSessionOpened)
+	defer func() {
+		stats <- MakeEvent(KafkaSessionClosed)
+		if err := producer.Close(); err != nil {
+			log.Println("Failed to shut down producer cleanly:", err)
+		}
+	}()
+
+	// inFlight bounds the number of messages enqueued with the broker but not yet
+	// acked/failed, so a wedged broker can't grow the queue without limit. Sends beyond
+	// the bound are dropped (and counted) rather than blocking the caller.
+	inFlight := make(chan struct{}, *kafkaMaxInFlightFlag)
+
+	go func() {
+		for range producer.Successes() {
+			<-inFlight
+			stats <- MakeEvent(KafkaMessageAcked)
+		}
+	}()
+	go func() {
+		for produceErr := range producer.Errors() {
+			<-inFlight
+			log.Println("Failed to write metrics to Kafka:", produceErr)
+			stats <- MakeEvent(KafkaMessageDropped)
+		}
+	}()
+
+	for {
+		var message Message
+		select {
+		case message = <-messages:
+		case <-ctx.Done():
+			return
+		case <-reconnect:
+			return
+		}
+		encoded, err := encoders.Encode(message.Topic, message.Data)
+		if err != nil {
+			log.Println("Failed to encode message:", err)
+			stats <- MakeEventSuff(KafkaMessageDropped, message.Topic)
+			continue
+		}
+		producerMessage := &sarama.ProducerMessage{
+			Topic: message.Topic,
+			Value: sarama.ByteEncoder(encoded),
+		}
+		if len(message.Key) != 0 {
+			producerMessage.Key = sarama.ByteEncoder(message.Key)
+		}
+		if *kafkaPartitionerFlag == "manual" {
+			producerMessage.Partition = message.Partition
+		}
+
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			stats <- MakeEventSuff(KafkaMessageDropped, message.Topic)
+			continue
+		}
+		select {
+		case producer.Input() <- producerMessage:
+			stats <- MakeEventSuff(KafkaMessageSent, message.Topic)
+		case <-ctx.Done():
+			<-inFlight
+			return
+		}
+	}
+}
+
+// ---
+
+func kafkaProducer(stats chan<- StatsEvent) (kafkaProducer sarama.AsyncProducer, err error) {
+	brokers, err := resolveBrokers(stats)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Kafka brokers:", strings.Join(brokers, ", "))
+
+	kafkaProducer, err = newAsyncProducer(brokers)
+	if err != nil {
+		return nil, fmt.Errorf("Producer creation against brokers %+v failed: %s", brokers, err)
+	}
+	return kafkaProducer, nil
+}
+
+// resolveBrokers returns the current broker list: the static -kafka-brokers override if set,
+// otherwise the result of the -kafka-discovery backend.
+func resolveBrokers(stats chan<- StatsEvent) ([]string, error) {
+	if len(*brokersFlag) != 0 {
+		brokers := strings.Split(*brokersFlag, ",")
+		if len(brokers) == 0 {
+			log.Fatal("-kafka-brokers must be non-empty.")
+		}
+		return brokers, nil
+	}
+
+	discovery, err := newBrokerDiscovery()
+	if err != nil {
+		flag.Usage()
+		log.Fatal(err)
+	}
+	brokers, err := discovery.Brokers()
+	if err != nil {
+		stats <- MakeEventSuff(KafkaLookupFailed, *kafkaDiscoveryFlag)
+		return nil, fmt.Errorf("Broker discovery (%s) failed: %s", *kafkaDiscoveryFlag, err)
+	}
+	return brokers, nil
+}
+
+func newAsyncProducer(brokerList []string) (producer sarama.AsyncProducer, err error) {
+	// For the access log, we are looking for AP semantics, with high throughput.
+	// By creating batches of compressed messages, we reduce network I/O at a cost of more latency.
+	config := sarama.NewConfig()
+	if *requireAllAcksFlag {
+		config.Producer.RequiredAcks = sarama.WaitForAll
+	} else {
+		config.Producer.RequiredAcks = sarama.WaitForLocal
+	}
+	if *snappyCompressionFlag {
+		config.Producer.Compression = sarama.CompressionSnappy
+	} else {
+		config.Producer.Compression = sarama.CompressionNone
+	}
+	config.Producer.Flush.Frequency = time.Duration(*flushPeriodFlag) * time.Millisecond
+	config.Producer.Flush.MaxMessages = *kafkaMaxInFlightFlag
+	config.Producer.Retry.Max = *kafkaRetryMaxFlag
+	config.Producer.Retry.Backoff = time.Duration(*kafkaRetryBackoffMsFlag) * time.Millisecond
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	configurePartitioner(config)
+
+	if err := configureTLS(config); err != nil {
+		return nil, fmt.Errorf("Failed to configure Kafka TLS: %s", err)
+	}
+	configureSASL(config)
+
+	return sarama.NewAsyncProducer(brokerList, config)
+}
+
+// ---
+
+// Returns a list of broker endpoints, each of the form "host:port"
+func lookupBrokers(framework string) (brokers []string, err error) {
+	schedulerEndpoint, err := connectionEndpoint(framework)
+	if err != nil {
+		return nil, err
+	}
+	body, err := HTTPGet(schedulerEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	return extractBrokers(body)
+}
+
+func connectionEndpoint(framework string) (endpoint string, err error) {
+	// Perform SRV lookup to get scheduler's port number:
+	// "_<framework>._tcp.marathon.mesos."
+	_, addrs, err := net.LookupSRV(framework, "tcp", "marathon.mesos")
+	if err != nil {
+		return "", err
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("Framework '%s' not found", framework)
+	}
+	url := fmt.Sprintf("http://%s.mesos:%d/v1/connection", framework, addrs[0].Port)
+	log.Println("Fetching broker list from Kafka Framework at:", url)
+	return url, nil
+}
+
+// configurePartitioner selects the partitioning strategy named by -kafka-partitioner,
+// defaulting to hashing the message Key when present and to random placement otherwise.
+func configurePartitioner(config *sarama.Config) {
+	switch *kafkaPartitionerFlag {
+	case "roundrobin":
+		config.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+	case "random":
+		config.Producer.Partitioner = sarama.NewRandomPartitioner
+	case "manual":
+		config.Producer.Partitioner = sarama.NewManualPartitioner
+	case "hash", "":
+		config.Producer.Partitioner = sarama.NewHashPartitioner
+	default:
+		log.Fatalf("Unrecognized -kafka-partitioner value %q", *kafkaPartitionerFlag)
+	}
+}
+
+// configureTLS enables TLS on config when a client certificate or CA bundle has been provided.
+func configureTLS(config *sarama.Config) error {
+	if len(*kafkaTLSCertFlag) == 0 && len(*kafkaTLSKeyFlag) == 0 && len(*kafkaTLSCAFlag) == 0 {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: !*kafkaTLSVerifyFlag,
+	}
+
+	if len(*kafkaTLSCertFlag) != 0 || len(*kafkaTLSKeyFlag) != 0 {
+		cert, err := tls.LoadX509KeyPair(*kafkaTLSCertFlag, *kafkaTLSKeyFlag)
+		if err != nil {
+			return fmt.Errorf("Failed to load client keypair from %s/%s: %s",
+				*kafkaTLSCertFlag, *kafkaTLSKeyFlag, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(*kafkaTLSCAFlag) != 0 {
+		caCert, err := ioutil.ReadFile(*kafkaTLSCAFlag)
+		if err != nil {
+			return fmt.Errorf("Failed to read CA bundle %s: %s", *kafkaTLSCAFlag, err)
+		}
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(caCert) {
+			return fmt.Errorf("No valid certificates found in CA bundle %s", *kafkaTLSCAFlag)
+		}
+		tlsConfig.RootCAs = caPool
+	}
+
+	config.Net.TLS.Enable = true
+	config.Net.TLS.Config = tlsConfig
+	return nil
+}
+
+// configureSASL enables SASL on config when a username has been provided.
+func configureSASL(config *sarama.Config) {
+	if len(*kafkaSASLUserFlag) == 0 {
+		return
+	}
+
+	config.Net.SASL.Enable = true
+	config.Net.SASL.User = *kafkaSASLUserFlag
+	config.Net.SASL.Password = *kafkaSASLPasswordFlag
+
+	switch strings.ToUpper(*kafkaSASLMechanismFlag) {
+	case "PLAIN":
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case "SCRAM-SHA-256":
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{HashGeneratorFcn: sha256Generator}
+		}
+	case "SCRAM-SHA-512":
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{HashGeneratorFcn: sha512Generator}
+		}
+	default:
+		log.Fatalf("Unrecognized -kafka-sasl-mechanism value %q", *kafkaSASLMechanismFlag)
+	}
+}
+
+func extractBrokers(body []byte) (brokers []string, err error) {
+	var jsonData map[string]interface{}
+	if err = json.Unmarshal(body, &jsonData); err != nil {
+		return nil, err
+	}
+	// expect "dns" entry containing a list of strings
+	jsonBrokers := jsonData["dns"].([]interface{})
+	brokers = make([]string, len(jsonBrokers))
+	for i, jsonDNSEntry := range jsonBrokers {
+		brokers[i] = jsonDNSEntry.(string)
+	}
+	return brokers, nil
+}
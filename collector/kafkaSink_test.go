@@ -0,0 +1,48 @@
+// Copyright 2016 Mesosphere, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestConfigurePartitioner(t *testing.T) {
+	cases := map[string]sarama.PartitionerConstructor{
+		"":           sarama.NewHashPartitioner,
+		"hash":       sarama.NewHashPartitioner,
+		"roundrobin": sarama.NewRoundRobinPartitioner,
+		"random":     sarama.NewRandomPartitioner,
+		"manual":     sarama.NewManualPartitioner,
+	}
+
+	original := *kafkaPartitionerFlag
+	defer func() { *kafkaPartitionerFlag = original }()
+
+	for value, want := range cases {
+		*kafkaPartitionerFlag = value
+		config := sarama.NewConfig()
+		configurePartitioner(config)
+
+		got := runtime.FuncForPC(reflect.ValueOf(config.Producer.Partitioner).Pointer()).Name()
+		wantName := runtime.FuncForPC(reflect.ValueOf(want).Pointer()).Name()
+		if got != wantName {
+			t.Errorf("configurePartitioner with -kafka-partitioner=%q set Partitioner %s, want %s", value, got, wantName)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2016 Mesosphere, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var outputFlag = StringEnvFlag("output", "kafka",
+	"Where to send collected metrics, as a comma separated list of: kafka, file, stdout, http.")
+
+// Message is a single metrics record to be delivered to a MessageSink.
+type Message struct {
+	Topic string
+	Data  []byte
+	// Key, when non-empty, is used by sinks that support partitioning (e.g. KafkaSink) to
+	// ensure all messages sharing a Key are delivered to the same partition.
+	Key []byte
+	// Partition is the destination partition to use when -kafka-partitioner=manual.
+	Partition int32
+}
+
+// KafkaMessage is a deprecated alias of Message, retained for existing callers.
+type KafkaMessage = Message
+
+// MessageSink delivers Messages to some downstream system. Implementations are expected to
+// handle their own reconnection/retry; Send must not block indefinitely if the downstream
+// system is unavailable.
+type MessageSink interface {
+	// Start begins any background delivery goroutines. It returns once the sink is ready
+	// to accept Sends; background delivery stops once ctx is cancelled. Sinks that deliver
+	// synchronously within Send (FileSink, StdoutSink) do not use ctx.
+	Start(ctx context.Context) error
+	// Send enqueues a Message for delivery. It must not block indefinitely.
+	Send(message Message) error
+	// Close releases any resources held by the sink. The sink must not be used afterwards.
+	Close() error
+}
+
+// NewSinks builds the MessageSink requested via -output, fanning out across all of them when
+// more than one destination is configured.
+func NewSinks(stats chan<- StatsEvent) (MessageSink, error) {
+	var sinks []MessageSink
+	for _, name := range strings.Split(*outputFlag, ",") {
+		switch strings.TrimSpace(name) {
+		case "kafka":
+			sinks = append(sinks, NewKafkaSink(stats))
+		case "file":
+			sinks = append(sinks, NewFileSink(stats))
+		case "stdout":
+			sinks = append(sinks, NewStdoutSink(stats))
+		case "http":
+			sinks = append(sinks, NewHTTPSink(stats))
+		default:
+			return nil, fmt.Errorf("Unrecognized -output value %q", name)
+		}
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return NewFanOutSink(sinks...), nil
+}
+
+// FanOutSink broadcasts every Message to a fixed set of sinks. It's what -output resolves to
+// when more than one destination is configured.
+type FanOutSink struct {
+	sinks []MessageSink
+}
+
+// NewFanOutSink returns a MessageSink that duplicates every Send across sinks.
+func NewFanOutSink(sinks ...MessageSink) *FanOutSink {
+	return &FanOutSink{sinks: sinks}
+}
+
+// Start implements MessageSink.
+func (f *FanOutSink) Start(ctx context.Context) error {
+	for _, sink := range f.sinks {
+		if err := sink.Start(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Send implements MessageSink, returning the first error encountered (after still attempting
+// delivery to every sink).
+func (f *FanOutSink) Send(message Message) error {
+	var firstErr error
+	for _, sink := range f.sinks {
+		if err := sink.Send(message); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Close implements MessageSink.
+func (f *FanOutSink) Close() error {
+	var firstErr error
+	for _, sink := range f.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// jsonMessage is the newline-delimited JSON representation used by FileSink and StdoutSink.
+// Data is rendered as a raw JSON value when it already holds one, falling back to base64 via
+// the default []byte JSON encoding otherwise.
+type jsonMessage struct {
+	Topic string          `json:"topic"`
+	Data  json.RawMessage `json:"data"`
+	Key   string          `json:"key,omitempty"`
+}
+
+func encodeMessageJSON(message Message) ([]byte, error) {
+	data := message.Data
+	if !json.Valid(data) {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		data = encoded
+	}
+	return json.Marshal(jsonMessage{
+		Topic: message.Topic,
+		Data:  json.RawMessage(data),
+		Key:   string(message.Key),
+	})
+}
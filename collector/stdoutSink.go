@@ -0,0 +1,55 @@
+// Copyright 2016 Mesosphere, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// StdoutSink writes each Message to stdout as newline-delimited JSON. It's intended for local
+// development and debugging, where running a Kafka cluster is more overhead than it's worth.
+type StdoutSink struct {
+	stats chan<- StatsEvent
+}
+
+// NewStdoutSink creates a StdoutSink.
+func NewStdoutSink(stats chan<- StatsEvent) *StdoutSink {
+	return &StdoutSink{stats: stats}
+}
+
+// Start implements MessageSink.
+func (s *StdoutSink) Start(ctx context.Context) error {
+	return nil
+}
+
+// Send implements MessageSink.
+func (s *StdoutSink) Send(message Message) error {
+	line, err := encodeMessageJSON(message)
+	if err != nil {
+		return fmt.Errorf("Failed to encode message for topic %s: %s", message.Topic, err)
+	}
+	if _, err := fmt.Fprintln(os.Stdout, string(line)); err != nil {
+		return err
+	}
+	s.stats <- MakeEventSuff(MessageSent, message.Topic)
+	return nil
+}
+
+// Close implements MessageSink.
+func (s *StdoutSink) Close() error {
+	return nil
+}